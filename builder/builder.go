@@ -0,0 +1,225 @@
+// Package builder provides a fluent, combinator-style API for constructing
+// brainfuck programs from Go code, rather than writing brainfuck source by
+// hand - the same itch the Haskell Control.Monad.BrainFuck package scratches.
+//
+// A Builder records a sequence of Op values as its methods are called:
+//
+//	b := builder.New()
+//	b.Inc(3)
+//	b.Right(2)
+//	b.Loop(func(b *builder.Builder) {
+//		b.Dec(1)
+//		b.Right(1)
+//		b.Inc(1)
+//		b.Left(1)
+//	})
+//	b.Out()
+//
+// Those Ops can be rendered back to canonical brainfuck source with
+// String(), or handed to package main's NewFromBuilder, which appends the
+// same vmFunc closures New() would have compiled the equivalent source
+// into - without ever round-tripping through text. builder itself knows
+// nothing about *main.VM: package main can't be imported (it's main), so
+// the bridge lives on the main side, the same way it does for the jit and
+// debug packages.
+package builder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kind identifies what an Op does.
+type Kind int
+
+const (
+	// KindInc adjusts the current cell by Arg (negative for "-").
+	KindInc Kind = iota
+	// KindShift adjusts the data pointer by Arg (negative for "<").
+	KindShift
+	// KindIn reads a byte into the current cell.
+	KindIn
+	// KindOut writes the current cell.
+	KindOut
+	// KindLoop repeats Body while the current cell is non-zero.
+	KindLoop
+	// KindClear sets the current cell to zero in one step - the "[-]"
+	// idiom, emitted directly rather than as a KindLoop so the peephole
+	// optimizer doesn't need to rediscover it.
+	KindClear
+	// KindMove distributes the current cell across Offsets and zeroes
+	// it - the "[->+<]" idiom, likewise emitted directly.
+	KindMove
+)
+
+// Op is a single recorded builder operation.
+type Op struct {
+	Kind Kind
+
+	// Arg is the operand for KindInc and KindShift.
+	Arg int
+
+	// Body is the loop body, for KindLoop.
+	Body []Op
+
+	// Offsets holds the offset->multiplier pairs for KindMove.
+	Offsets map[int]int
+}
+
+// Builder accumulates Ops as its methods are called. The zero value is an
+// empty Builder, the same one New returns.
+type Builder struct {
+	ops []Op
+
+	// building is true for the lifetime of a Loop callback running
+	// against this exact Builder - it lets Build reject being called on
+	// a loop body that hasn't finished recording yet.
+	building bool
+}
+
+// New creates an empty Builder.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Inc adds n to the current cell.
+func (b *Builder) Inc(n int) *Builder {
+	b.ops = append(b.ops, Op{Kind: KindInc, Arg: n})
+	return b
+}
+
+// Dec subtracts n from the current cell.
+func (b *Builder) Dec(n int) *Builder {
+	b.ops = append(b.ops, Op{Kind: KindInc, Arg: -n})
+	return b
+}
+
+// Right moves the data pointer right by n cells.
+func (b *Builder) Right(n int) *Builder {
+	b.ops = append(b.ops, Op{Kind: KindShift, Arg: n})
+	return b
+}
+
+// Left moves the data pointer left by n cells.
+func (b *Builder) Left(n int) *Builder {
+	b.ops = append(b.ops, Op{Kind: KindShift, Arg: -n})
+	return b
+}
+
+// In reads a single byte of input into the current cell.
+func (b *Builder) In() *Builder {
+	b.ops = append(b.ops, Op{Kind: KindIn})
+	return b
+}
+
+// Out writes the current cell.
+func (b *Builder) Out() *Builder {
+	b.ops = append(b.ops, Op{Kind: KindOut})
+	return b
+}
+
+// Clear sets the current cell to zero, emitting the "[-]" idiom directly.
+func (b *Builder) Clear() *Builder {
+	b.ops = append(b.ops, Op{Kind: KindClear})
+	return b
+}
+
+// Move adds the current cell's value to the cell at offset, then zeroes
+// the current cell, emitting the "[->+<]"-style idiom directly.
+func (b *Builder) Move(offset int) *Builder {
+	b.ops = append(b.ops, Op{Kind: KindMove, Offsets: map[int]int{offset: 1}})
+	return b
+}
+
+// Loop records a "[...]": fn is called with a fresh Builder representing
+// the loop body, and whatever it records becomes that loop's Body once fn
+// returns. Because the body is only ever reachable from inside fn, loops
+// built this way are balanced by construction - there's no separate
+// "close the loop" call to forget.
+//
+// b itself is also marked as building for the duration of fn, not just
+// body - fn closes over b as well as body, and a callback that reaches out
+// and calls b.Build() instead of body.Build() must be rejected too.
+func (b *Builder) Loop(fn func(*Builder)) *Builder {
+	body := &Builder{building: true}
+
+	prevBuilding := b.building
+	b.building = true
+	fn(body)
+	b.building = prevBuilding
+
+	body.building = false
+
+	b.ops = append(b.ops, Op{Kind: KindLoop, Body: body.ops})
+	return b
+}
+
+// Build finalizes the recorded Ops, and returns an error if called while a
+// Loop body belonging to this Builder, or one it is itself nested inside of,
+// is still being recorded - which can happen if a Loop callback reaches back
+// out and calls Build on an enclosing Builder instead of the one it was
+// handed.
+func (b *Builder) Build() ([]Op, error) {
+	if b.building {
+		return nil, fmt.Errorf("builder: Build called inside an open loop")
+	}
+	return b.ops, nil
+}
+
+// String renders the recorded Ops as canonical brainfuck source.
+func (b *Builder) String() string {
+	var s strings.Builder
+	writeOps(&s, b.ops)
+	return s.String()
+}
+
+func writeOps(s *strings.Builder, ops []Op) {
+	for _, op := range ops {
+		switch op.Kind {
+		case KindInc:
+			writeRun(s, '+', '-', op.Arg)
+		case KindShift:
+			writeRun(s, '>', '<', op.Arg)
+		case KindIn:
+			s.WriteByte(',')
+		case KindOut:
+			s.WriteByte('.')
+		case KindClear:
+			s.WriteString("[-]")
+		case KindMove:
+			writeMove(s, op.Offsets)
+		case KindLoop:
+			s.WriteByte('[')
+			writeOps(s, op.Body)
+			s.WriteByte(']')
+		}
+	}
+}
+
+// writeRun writes n repetitions of pos if n is positive, or -n repetitions
+// of neg if n is negative.
+func writeRun(s *strings.Builder, pos, neg byte, n int) {
+	if n >= 0 {
+		s.WriteString(strings.Repeat(string(pos), n))
+	} else {
+		s.WriteString(strings.Repeat(string(neg), -n))
+	}
+}
+
+// writeMove renders the canonical "[->...+...<...]" source for a Move op.
+func writeMove(s *strings.Builder, offsets map[int]int) {
+	keys := make([]int, 0, len(offsets))
+	for k := range offsets {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	s.WriteString("[-")
+	for _, k := range keys {
+		writeRun(s, '>', '<', k)
+		writeRun(s, '+', '-', offsets[k])
+		writeRun(s, '<', '>', k)
+	}
+	s.WriteByte(']')
+}
@@ -0,0 +1,86 @@
+package builder
+
+import "testing"
+
+// TestStringRendersCanonicalSource checks that a handful of builder
+// programs render back to the brainfuck source an equivalent hand-written
+// program would be.
+func TestStringRendersCanonicalSource(t *testing.T) {
+	cases := []struct {
+		name  string
+		build func(b *Builder)
+		want  string
+	}{
+		{
+			name:  "straight-line ops",
+			build: func(b *Builder) { b.Inc(3).Right(2).Dec(1).Left(1).In().Out() },
+			want:  "+++>>-<,.",
+		},
+		{
+			name: "loop",
+			build: func(b *Builder) {
+				b.Loop(func(inner *Builder) {
+					inner.Dec(1).Right(1).Inc(1).Left(1)
+				})
+			},
+			want: "[->+<]",
+		},
+		{
+			name:  "clear",
+			build: func(b *Builder) { b.Clear() },
+			want:  "[-]",
+		},
+		{
+			name:  "move",
+			build: func(b *Builder) { b.Move(2) },
+			want:  "[->>+<<]",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := New()
+			c.build(b)
+			if got := b.String(); got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+// TestBuildRejectsOpenLoop checks the "Build called inside an open loop"
+// guard, including the case where the callback reaches out to the
+// enclosing Builder instead of the one it was handed.
+func TestBuildRejectsOpenLoop(t *testing.T) {
+	t.Run("direct", func(t *testing.T) {
+		b := New()
+		var insideErr error
+		b.Loop(func(inner *Builder) {
+			_, insideErr = inner.Build()
+		})
+		if insideErr == nil {
+			t.Fatal("expected Build to fail while the loop it belongs to is still open")
+		}
+	})
+
+	t.Run("outer builder captured via closure", func(t *testing.T) {
+		b := New()
+		var outerErr error
+		b.Loop(func(inner *Builder) {
+			_, outerErr = b.Build()
+		})
+		if outerErr == nil {
+			t.Fatal("expected Build on the outer builder to fail too")
+		}
+	})
+
+	t.Run("succeeds once closed", func(t *testing.T) {
+		b := New()
+		b.Loop(func(inner *Builder) {
+			inner.Dec(1)
+		})
+		if _, err := b.Build(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
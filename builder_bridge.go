@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+
+	"github.com/skx/closure-based-brainfuck-vm/builder"
+)
+
+// NewFromBuilder builds a VM directly from a builder.Builder's recorded
+// Ops, the same way New builds one from brainfuck source - except the
+// Ops are lowered straight into vmFunc closures, with no text to parse.
+//
+// Loop bodies are still run through the same idiom detection the peephole
+// optimizer in New applies, so builder.Clear and builder.Move aren't the
+// only way to get the specialized closures: a hand-rolled b.Loop(...) that
+// happens to match one of those shapes gets the same treatment.
+func NewFromBuilder(b *builder.Builder, cfg Config) (*VM, error) {
+	ops, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &VM{
+		config:   cfg,
+		memory:   make([]int, cfg.MemorySize),
+		cellMask: cfg.CellSize.mask(),
+	}
+	if cfg.BufferStdout {
+		v.stdout = bufio.NewWriter(cfg.Stdout)
+	}
+
+	if err := lowerBuilderOps(v, ops); err != nil {
+		return nil, err
+	}
+
+	v.program = append(v.program, makeExit())
+	v.SourceMap = append(v.SourceMap, SourceRange{})
+
+	return v, nil
+}
+
+// lowerBuilderOps appends the closures for ops onto v.program, recursing
+// into loop bodies. Builder-originated programs have no brainfuck source
+// of their own, so every SourceMap entry it adds is the zero SourceRange.
+func lowerBuilderOps(v *VM, ops []builder.Op) error {
+	for _, op := range ops {
+		switch op.Kind {
+		case builder.KindInc:
+			if op.Arg >= 0 {
+				v.program = append(v.program, makeIncCell(op.Arg))
+			} else {
+				v.program = append(v.program, makeDecCell(-op.Arg))
+			}
+
+		case builder.KindShift:
+			if op.Arg >= 0 {
+				v.program = append(v.program, makeIncPtr(op.Arg))
+			} else {
+				v.program = append(v.program, makeDecPtr(-op.Arg))
+			}
+
+		case builder.KindIn:
+			v.program = append(v.program, makeRead())
+
+		case builder.KindOut:
+			if v.config.BufferStdout {
+				v.program = append(v.program, makeWriteCached())
+			} else {
+				v.program = append(v.program, makeWrite())
+			}
+
+		case builder.KindClear:
+			v.program = append(v.program, makeClearCell())
+
+		case builder.KindMove:
+			v.program = append(v.program, makeMulMove(op.Offsets))
+
+		case builder.KindLoop:
+			if fn, ok := detectBuilderIdiom(op.Body); ok {
+				v.program = append(v.program, fn)
+				v.SourceMap = append(v.SourceMap, SourceRange{})
+				continue
+			}
+
+			open := len(v.program)
+			v.program = append(v.program, nil)
+			v.SourceMap = append(v.SourceMap, SourceRange{})
+
+			if err := lowerBuilderOps(v, op.Body); err != nil {
+				return err
+			}
+
+			v.program[open] = makeLoopOpen(len(v.program))
+			v.program = append(v.program, makeLoopClose(open))
+
+		default:
+			return fmt.Errorf("builder: unknown op kind %d", op.Kind)
+		}
+
+		v.SourceMap = append(v.SourceMap, SourceRange{})
+	}
+
+	return nil
+}
+
+// detectBuilderIdiom mirrors peepholeOp, but works over a loop's already
+// structured Ops instead of raw brainfuck text.
+func detectBuilderIdiom(ops []builder.Op) (vmFunc, bool) {
+	if len(ops) == 1 {
+		switch {
+		case ops[0].Kind == builder.KindInc && (ops[0].Arg == 1 || ops[0].Arg == -1):
+			return makeClearCell(), true
+		case ops[0].Kind == builder.KindShift && ops[0].Arg > 0:
+			return makeScanRight(ops[0].Arg), true
+		case ops[0].Kind == builder.KindShift && ops[0].Arg < 0:
+			return makeScanLeft(-ops[0].Arg), true
+		}
+	}
+
+	offset := 0
+	deltas := map[int]int{}
+
+	for _, op := range ops {
+		switch op.Kind {
+		case builder.KindInc:
+			deltas[offset] += op.Arg
+		case builder.KindShift:
+			offset += op.Arg
+		default:
+			return nil, false
+		}
+	}
+
+	if offset != 0 || deltas[0] != -1 {
+		return nil, false
+	}
+
+	delete(deltas, 0)
+	if len(deltas) == 0 {
+		return nil, false
+	}
+
+	return makeMulMove(deltas), true
+}
@@ -0,0 +1,199 @@
+package main
+
+import "errors"
+
+// opKind identifies one instruction in the shared compiled-program
+// representation that compileProgram produces.
+type opKind int
+
+const (
+	opIncCell opKind = iota
+	opIncPtr
+	opRead
+	opWrite
+	opLoopOpen
+	opLoopClose
+	opClearCell
+	opMulMove
+	opScanRight
+	opScanLeft
+)
+
+// op is a single compiled instruction, alongside the byte range of the
+// brainfuck source it came from.
+type op struct {
+	kind opKind
+
+	// arg is the operand for opIncCell, opIncPtr, opScanRight and
+	// opScanLeft. A negative arg on opIncCell/opIncPtr stands for the
+	// "-"/"<" direction, the way jit.Instr's Arg already does.
+	arg int
+
+	// target is the instruction index to jump to for opLoopOpen and
+	// opLoopClose.
+	target int
+
+	// offsets holds the offset->multiplier pairs for opMulMove.
+	offsets map[int]int
+
+	// start, end are the [start,end) byte range of bf this op was
+	// compiled from.
+	start, end int
+}
+
+// compileProgram scans bf once, collapsing runs of "+"/"-"/"<"/">" and
+// recognising the peephole idioms peepholeOp knows about, into a single
+// compiled representation.
+//
+// New() and RunProgramJIT both lower this same []op - one to vmFunc
+// closures, the other to jit.Instr - rather than each scanning bf
+// themselves. Two independent scanners drift: a bracket-matching or
+// run-length tweak made to one is easy to forget in the other, and that's
+// exactly what happened before this existed.
+func compileProgram(bf string) ([]op, error) {
+	if len(bf) < 1 {
+		return nil, errors.New("empty program is invalid")
+	}
+
+	var prog []op
+	loopStack := []int{}
+
+	i := 0
+	max := len(bf)
+
+	// countRepeats counts how many consecutive times c is repeated
+	// starting at i, returning the count and the index of the run's
+	// last matching byte (the caller's loop ends every iteration with
+	// an unconditional i++, so this is one short of where i should end
+	// up next).
+	countRepeats := func(i int, c byte) (int, int) {
+		begin := i
+		for i < max && bf[i] == c {
+			i++
+		}
+		return i - begin, i - 1
+	}
+
+	for i < max {
+		c := bf[i]
+		start := i
+
+		switch c {
+		case '+':
+			count, ni := countRepeats(i, c)
+			prog = append(prog, op{kind: opIncCell, arg: count, start: start, end: ni + 1})
+			i = ni
+		case '-':
+			count, ni := countRepeats(i, c)
+			prog = append(prog, op{kind: opIncCell, arg: -count, start: start, end: ni + 1})
+			i = ni
+		case '>':
+			count, ni := countRepeats(i, c)
+			prog = append(prog, op{kind: opIncPtr, arg: count, start: start, end: ni + 1})
+			i = ni
+		case '<':
+			count, ni := countRepeats(i, c)
+			prog = append(prog, op{kind: opIncPtr, arg: -count, start: start, end: ni + 1})
+			i = ni
+		case ',':
+			prog = append(prog, op{kind: opRead, start: start, end: i + 1})
+		case '.':
+			prog = append(prog, op{kind: opWrite, start: start, end: i + 1})
+		case '[':
+			if closeIdx, ok := findMatchingBracket(bf, i); ok {
+				if o, ok := peepholeOp(bf[i+1 : closeIdx]); ok {
+					o.start, o.end = start, closeIdx+1
+					prog = append(prog, o)
+					i = closeIdx + 1
+					continue
+				}
+			}
+
+			loopStack = append(loopStack, len(prog))
+			prog = append(prog, op{kind: opLoopOpen, start: start, end: i + 1})
+		case ']':
+			open := loopStack[len(loopStack)-1]
+			loopStack = loopStack[:len(loopStack)-1]
+
+			prog[open].target = len(prog)
+			prog = append(prog, op{kind: opLoopClose, target: open, start: start, end: i + 1})
+		default:
+			// ignored, as elsewhere
+		}
+		i++
+	}
+
+	return prog, nil
+}
+
+// peepholeOp examines the body of a "[...]" loop, not including the
+// brackets themselves, and returns a specialized op implementing it if the
+// body matches one of the idioms compileProgram knows how to optimize.
+//
+// The idioms recognised are:
+//
+//   - "[-]" or "[+]", which simply zero the current cell.
+//
+//   - "[>]" or "[<]", which scan the pointer forwards/backwards until it
+//     finds a zero cell.
+//
+//   - "move" loops such as "[->+<]", "[->>+<<]" or "[->+>+<<]", which
+//     decrement the current cell by one, distribute some multiple of its
+//     original value across one or more other cells, and return the
+//     pointer back to where it started.
+func peepholeOp(body string) (op, bool) {
+	if body == "-" || body == "+" {
+		return op{kind: opClearCell}, true
+	}
+
+	if len(body) > 0 && allBytes(body, '>') {
+		return op{kind: opScanRight, arg: len(body)}, true
+	}
+	if len(body) > 0 && allBytes(body, '<') {
+		return op{kind: opScanLeft, arg: len(body)}, true
+	}
+
+	if offsets, ok := moveLoopOffsets(body); ok {
+		return op{kind: opMulMove, offsets: offsets}, true
+	}
+
+	return op{}, false
+}
+
+// lowerOp turns a single compiled op into the vmFunc closure New() runs for
+// it.
+func lowerOp(v *VM, o op) vmFunc {
+	switch o.kind {
+	case opIncCell:
+		if o.arg >= 0 {
+			return makeIncCell(o.arg)
+		}
+		return makeDecCell(-o.arg)
+	case opIncPtr:
+		if o.arg >= 0 {
+			return makeIncPtr(o.arg)
+		}
+		return makeDecPtr(-o.arg)
+	case opRead:
+		return makeRead()
+	case opWrite:
+		if v.config.BufferStdout {
+			return makeWriteCached()
+		}
+		return makeWrite()
+	case opLoopOpen:
+		return makeLoopOpen(o.target)
+	case opLoopClose:
+		return makeLoopClose(o.target)
+	case opClearCell:
+		return makeClearCell()
+	case opMulMove:
+		return makeMulMove(o.offsets)
+	case opScanRight:
+		return makeScanRight(o.arg)
+	case opScanLeft:
+		return makeScanLeft(o.arg)
+	default:
+		return nil
+	}
+}
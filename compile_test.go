@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+// TestCompileProgramSourceRanges pins the [start,end) byte ranges
+// compileProgram records for a few known programs. A run's end must land
+// exactly on the byte after the run, not one past it - overlapping the
+// start of whatever follows breaks anything that highlights "the current
+// instruction" in the source, such as the debugger.
+func TestCompileProgramSourceRanges(t *testing.T) {
+	cases := []struct {
+		name string
+		bf   string
+		want []op
+	}{
+		{
+			name: "run followed by another op",
+			bf:   "+++.",
+			want: []op{
+				{kind: opIncCell, arg: 3, start: 0, end: 3},
+				{kind: opWrite, start: 3, end: 4},
+			},
+		},
+		{
+			name: "single-byte run",
+			bf:   "+.",
+			want: []op{
+				{kind: opIncCell, arg: 1, start: 0, end: 1},
+				{kind: opWrite, start: 1, end: 2},
+			},
+		},
+		{
+			name: "peepholed loop covers its brackets",
+			bf:   "+[>].",
+			want: []op{
+				{kind: opIncCell, arg: 1, start: 0, end: 1},
+				{kind: opScanRight, arg: 1, start: 1, end: 4},
+				{kind: opWrite, start: 4, end: 5},
+			},
+		},
+		{
+			name: "generic loop",
+			bf:   "+[.-].",
+			want: []op{
+				{kind: opIncCell, arg: 1, start: 0, end: 1},
+				{kind: opLoopOpen, target: 4, start: 1, end: 2},
+				{kind: opWrite, start: 2, end: 3},
+				{kind: opIncCell, arg: -1, start: 3, end: 4},
+				{kind: opLoopClose, target: 1, start: 4, end: 5},
+				{kind: opWrite, start: 5, end: 6},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := compileProgram(c.bf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("got %d ops, want %d: %+v", len(got), len(c.want), got)
+			}
+			for i := range got {
+				g, w := got[i], c.want[i]
+				if g.kind != w.kind || g.arg != w.arg || g.target != w.target || g.start != w.start || g.end != w.end {
+					t.Errorf("op %d: got %+v, want %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// CellSize controls how many bits a single memory cell holds, and
+// therefore at what value it wraps back around to zero.
+type CellSize int
+
+const (
+	// Cell8 gives classic byte-sized cells: 0-255, wrapping.
+	Cell8 CellSize = 8
+	// Cell16 gives 16-bit cells: 0-65535, wrapping.
+	Cell16 CellSize = 16
+	// Cell32 gives 32-bit cells: 0-4294967295, wrapping.
+	Cell32 CellSize = 32
+)
+
+// mask returns the bitmask a cell's value should be AND-ed with after every
+// write, which is what gives cells their wraparound behaviour.
+func (c CellSize) mask() int {
+	return (1 << uint(c)) - 1
+}
+
+// EOFBehavior controls what happens to the current cell when "," reads
+// past the end of input.
+type EOFBehavior int
+
+const (
+	// EOFLeaveUnchanged leaves the current cell as it was.
+	EOFLeaveUnchanged EOFBehavior = iota
+	// EOFZero sets the current cell to zero.
+	EOFZero
+	// EOFMinusOne sets the current cell to -1, i.e. every bit of the
+	// configured cell size set, once masked.
+	EOFMinusOne
+)
+
+// TapeMode controls what happens when the data pointer moves outside the
+// bounds of the allocated memory.
+type TapeMode int
+
+const (
+	// TapeBounded does nothing special - a pointer which leaves the tape
+	// will fault the next time memory is accessed, exactly as a plain Go
+	// slice index out of range would.
+	TapeBounded TapeMode = iota
+	// TapeWrapAround wraps the pointer back onto the tape, so that moving
+	// right off the end brings it back to the start and vice versa.
+	TapeWrapAround
+	// TapeDynamic grows the tape with zeroed cells whenever the pointer
+	// would otherwise move past its right-hand end. It does not grow
+	// leftwards - moving the pointer negative is still a bounds fault.
+	TapeDynamic
+)
+
+// Config controls the VM's I/O and memory semantics. The zero Config is
+// not valid to pass to New directly; start from DefaultConfig and override
+// what you need instead.
+type Config struct {
+	// Stdin is where "," reads a byte from.
+	Stdin io.Reader
+	// Stdout is where "." writes a byte to.
+	Stdout io.Writer
+
+	// CellSize is the width, in bits, of a single memory cell.
+	CellSize CellSize
+	// MemorySize is the number of cells the tape starts with.
+	MemorySize int
+	// EOFBehavior controls what "," does once Stdin is exhausted.
+	EOFBehavior EOFBehavior
+	// TapeMode controls what happens when the pointer leaves the tape.
+	TapeMode TapeMode
+
+	// BufferStdout, if true, batches writes through a bufio.Writer and
+	// flushes them on a newline and when RunProgram stops, rather than
+	// writing straight through to Stdout on every ".".
+	BufferStdout bool
+}
+
+// DefaultConfig returns the Config New used implicitly before Config
+// existed: stdin/stdout wired to the console, 32-bit cells, a 30,000 cell
+// bounded tape, EOF left the current cell unchanged, and buffered output.
+func DefaultConfig() Config {
+	return Config{
+		Stdin:        os.Stdin,
+		Stdout:       os.Stdout,
+		CellSize:     Cell32,
+		MemorySize:   30000,
+		EOFBehavior:  EOFLeaveUnchanged,
+		TapeMode:     TapeBounded,
+		BufferStdout: true,
+	}
+}
@@ -0,0 +1,244 @@
+// Package debug implements a step-by-step debugger over the closure-based
+// brainfuck VM in package main.
+//
+// It never imports package main - Go doesn't allow importing "main" from
+// anywhere else - so it talks to the VM purely through the small Machine
+// interface below, which *main.VM satisfies structurally. The VM's own
+// Step/IP/Ptr/Memory/Source accessors were added specifically to make this
+// possible.
+package debug
+
+import "fmt"
+
+// Machine is the subset of *main.VM the debugger needs.
+type Machine interface {
+	// Step executes the single instruction at IP and advances it.
+	Step() error
+
+	// IP returns the instruction that Step will run next.
+	IP() int
+	// SetIP moves the instruction pointer without executing anything.
+	SetIP(ip int)
+
+	// Ptr returns the current data pointer.
+	Ptr() int
+	// SetPtr moves the data pointer without executing anything.
+	SetPtr(ptr int)
+
+	// Memory returns the VM's tape, aliased rather than copied.
+	Memory() []int
+
+	// Len returns the number of compiled program slots.
+	Len() int
+	// Source returns the [start,end) source range a program slot came from.
+	Source(ip int) (start, end int)
+}
+
+// BreakReason identifies why execution stopped at a breakpoint.
+type BreakReason int
+
+const (
+	// BreakOffset fires when IP's source range starts at a given offset.
+	BreakOffset BreakReason = iota
+	// BreakPtrEnters fires the first time the data pointer becomes a
+	// given cell.
+	BreakPtrEnters
+	// BreakMemoryBecomes fires when a given cell becomes a given value.
+	BreakMemoryBecomes
+)
+
+// Breakpoint is a single stop condition.
+type Breakpoint struct {
+	Reason BreakReason
+
+	// Offset is the source byte offset, for BreakOffset.
+	Offset int
+
+	// Cell is the memory cell, for BreakPtrEnters and BreakMemoryBecomes.
+	Cell int
+
+	// Value is the value the cell must become, for BreakMemoryBecomes.
+	Value int
+}
+
+// snapshot captures everything needed to undo one or more Steps.
+type snapshot struct {
+	ip     int
+	ptr    int
+	memory []int
+	stdout int // length of output already produced, for trimming on rewind
+}
+
+// Debugger drives a Machine one instruction at a time, evaluating
+// breakpoints between steps and keeping enough history to step backwards.
+type Debugger struct {
+	vm     Machine
+	source string
+
+	breakpoints []Breakpoint
+	seenPtr     map[int]bool
+
+	// memWasTrue tracks, per breakpoint index, whether that
+	// BreakMemoryBecomes condition held on the previous check - so
+	// checkBreakpoints can fire on the false->true transition instead of
+	// refiring on every Step() the condition continues to hold.
+	memWasTrue map[int]bool
+
+	// history holds a snapshot taken every time we're about to execute a
+	// loop-open instruction ("["), which gives reverse-step somewhere
+	// sensible to rewind to without snapshotting on every single step.
+	history []snapshot
+
+	// out captures everything the program writes, so the TUI can show
+	// recent stdout.
+	out *Sink
+}
+
+// Sink is an io.Writer that the VM's Config.Stdout should be pointed at
+// before compiling the program a Debugger will drive - it gives the
+// debugger somewhere to read recent output back from, since package main's
+// VM has no concept of a debugger and the two can't see each other's
+// internals beyond the Machine interface.
+type Sink struct {
+	buf []byte
+}
+
+// NewSink creates an empty output Sink.
+func NewSink() *Sink {
+	return &Sink{}
+}
+
+// Write appends p to the sink's buffer. It satisfies io.Writer.
+func (s *Sink) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	return len(p), nil
+}
+
+// Bytes returns everything written to the sink so far.
+func (s *Sink) Bytes() []byte {
+	return s.buf
+}
+
+// Truncate discards everything written to the sink past n bytes. It exists
+// for Debugger.ReverseStep to roll output back alongside memory and ip/ptr.
+func (s *Sink) Truncate(n int) {
+	s.buf = s.buf[:n]
+}
+
+// New creates a Debugger which drives vm, whose program was compiled from
+// source. out should be the same Sink that vm's Config.Stdout was pointed
+// at when it was built.
+func New(vm Machine, source string, out *Sink) *Debugger {
+	return &Debugger{
+		vm:         vm,
+		source:     source,
+		seenPtr:    map[int]bool{},
+		memWasTrue: map[int]bool{},
+		out:        out,
+	}
+}
+
+// Break registers a breakpoint.
+func (d *Debugger) Break(bp Breakpoint) {
+	d.breakpoints = append(d.breakpoints, bp)
+}
+
+// Step executes a single instruction, snapshotting first if it is a loop
+// boundary, and reports whether a breakpoint now matches.
+func (d *Debugger) Step() (hit *Breakpoint, err error) {
+	ip := d.vm.IP()
+
+	if d.atLoopOpen(ip) {
+		d.history = append(d.history, d.snapshot())
+	}
+
+	if err = d.vm.Step(); err != nil {
+		return nil, err
+	}
+
+	return d.checkBreakpoints(), nil
+}
+
+// ReverseStep rewinds to the most recent loop-boundary snapshot. It returns
+// an error if there is no history left to rewind to.
+func (d *Debugger) ReverseStep() error {
+	if len(d.history) == 0 {
+		return fmt.Errorf("debug: no history to reverse into")
+	}
+
+	s := d.history[len(d.history)-1]
+	d.history = d.history[:len(d.history)-1]
+
+	d.vm.SetIP(s.ip)
+	d.vm.SetPtr(s.ptr)
+	copy(d.vm.Memory(), s.memory)
+	d.out.Truncate(s.stdout)
+
+	return nil
+}
+
+// RunToCursor steps until IP reaches target, or a breakpoint fires first.
+func (d *Debugger) RunToCursor(target int) (hit *Breakpoint, err error) {
+	for d.vm.IP() != target {
+		hit, err = d.Step()
+		if err != nil || hit != nil {
+			return hit, err
+		}
+	}
+	return nil, nil
+}
+
+// atLoopOpen reports whether the program slot at ip was compiled from a "["
+// in the source.
+func (d *Debugger) atLoopOpen(ip int) bool {
+	start, _ := d.vm.Source(ip)
+	return start < len(d.source) && d.source[start] == '['
+}
+
+func (d *Debugger) snapshot() snapshot {
+	mem := make([]int, len(d.vm.Memory()))
+	copy(mem, d.vm.Memory())
+
+	return snapshot{
+		ip:     d.vm.IP(),
+		ptr:    d.vm.Ptr(),
+		memory: mem,
+		stdout: len(d.out.Bytes()),
+	}
+}
+
+func (d *Debugger) checkBreakpoints() *Breakpoint {
+	ptr := d.vm.Ptr()
+	if !d.seenPtr[ptr] {
+		d.seenPtr[ptr] = true
+		for i := range d.breakpoints {
+			bp := d.breakpoints[i]
+			if bp.Reason == BreakPtrEnters && bp.Cell == ptr {
+				return &bp
+			}
+		}
+	}
+
+	ip := d.vm.IP()
+	start, _ := d.vm.Source(ip)
+	mem := d.vm.Memory()
+
+	for i := range d.breakpoints {
+		bp := d.breakpoints[i]
+		switch bp.Reason {
+		case BreakOffset:
+			if start == bp.Offset {
+				return &bp
+			}
+		case BreakMemoryBecomes:
+			now := bp.Cell >= 0 && bp.Cell < len(mem) && mem[bp.Cell] == bp.Value
+			wasTrue := d.memWasTrue[i]
+			d.memWasTrue[i] = now
+			if now && !wasTrue {
+				return &bp
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package debug
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// model is the Bubble Tea model driving the interactive debugger.
+type model struct {
+	dbg    *Debugger
+	source string
+
+	cmd    string
+	status string
+	done   bool
+}
+
+var (
+	currentStyle = lipgloss.NewStyle().Reverse(true)
+	ptrStyle     = lipgloss.NewStyle().Reverse(true)
+	statusStyle  = lipgloss.NewStyle().Faint(true)
+)
+
+// Run starts the interactive TUI debugger over vm, whose program was
+// compiled from source. out must be the same Sink vm's Config.Stdout was
+// pointed at when it was built, so the TUI can show what the program has
+// written.
+func Run(vm Machine, source string, out *Sink) error {
+	dbg := New(vm, source, out)
+
+	m := model{dbg: dbg, source: source, status: "step: s  run: r  reverse: b  break: :cmd  quit: q"}
+	_, err := tea.NewProgram(m).Run()
+	return err
+}
+
+func (m model) Init() tea.Cmd {
+	return nil
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	// Once ":" has opened the command line, keys are typed into it rather
+	// than acting as the s/b/r/q shortcuts, until enter runs it.
+	if key := keyMsg.String(); strings.HasPrefix(m.cmd, ":") && len(key) == 1 {
+		m.cmd += key
+		return m, nil
+	}
+
+	switch keyMsg.String() {
+	case "ctrl+c", "q":
+		return m, tea.Quit
+
+	case "s":
+		m.step()
+		return m, nil
+
+	case "b":
+		if err := m.dbg.ReverseStep(); err != nil {
+			m.status = err.Error()
+		}
+		return m, nil
+
+	case "r":
+		for !m.done {
+			if !m.step() {
+				break
+			}
+		}
+		return m, nil
+
+	case "enter":
+		m.runCommand()
+		m.cmd = ""
+		return m, nil
+
+	case "backspace":
+		if len(m.cmd) > 0 {
+			m.cmd = m.cmd[:len(m.cmd)-1]
+		}
+		return m, nil
+
+	default:
+		if len(keyMsg.String()) == 1 {
+			m.cmd += keyMsg.String()
+		}
+		return m, nil
+	}
+}
+
+// step executes a single instruction and reports whether it's safe to keep
+// stepping (false once the program has exited or hit a breakpoint).
+func (m *model) step() bool {
+	if m.done {
+		return false
+	}
+
+	hit, err := m.dbg.Step()
+	if err != nil {
+		m.done = true
+		m.status = fmt.Sprintf("program finished: %s", err)
+		return false
+	}
+	if hit != nil {
+		m.status = fmt.Sprintf("breakpoint hit: %+v", *hit)
+		return false
+	}
+	return true
+}
+
+// runCommand parses and applies a ":"-prefixed breakpoint command typed
+// into the command line, e.g. "break offset 10", "break ptr 5" or
+// "break mem 3 65".
+func (m *model) runCommand() {
+	fields := strings.Fields(strings.TrimPrefix(m.cmd, ":"))
+	if len(fields) < 2 || fields[0] != "break" {
+		m.status = fmt.Sprintf("unrecognised command: %q", m.cmd)
+		return
+	}
+
+	switch fields[1] {
+	case "offset":
+		if len(fields) < 3 {
+			m.status = "usage: break offset <n>"
+			return
+		}
+		if n, err := strconv.Atoi(fields[2]); err == nil {
+			m.dbg.Break(Breakpoint{Reason: BreakOffset, Offset: n})
+			m.status = fmt.Sprintf("breakpoint set at source offset %d", n)
+		}
+	case "ptr":
+		if len(fields) < 3 {
+			m.status = "usage: break ptr <cell>"
+			return
+		}
+		if n, err := strconv.Atoi(fields[2]); err == nil {
+			m.dbg.Break(Breakpoint{Reason: BreakPtrEnters, Cell: n})
+			m.status = fmt.Sprintf("breakpoint set on ptr entering cell %d", n)
+		}
+	case "mem":
+		if len(fields) >= 4 {
+			cell, err1 := strconv.Atoi(fields[2])
+			val, err2 := strconv.Atoi(fields[3])
+			if err1 == nil && err2 == nil {
+				m.dbg.Break(Breakpoint{Reason: BreakMemoryBecomes, Cell: cell, Value: val})
+				m.status = fmt.Sprintf("breakpoint set on memory[%d] == %d", cell, val)
+			}
+		}
+	default:
+		m.status = fmt.Sprintf("unrecognised breakpoint kind: %q", fields[1])
+	}
+}
+
+func (m model) View() string {
+	var b strings.Builder
+
+	b.WriteString(m.renderSource())
+	b.WriteString("\n\n")
+	b.WriteString(m.renderTape())
+	b.WriteString("\n\n")
+	b.WriteString("stdout: " + string(m.dbg.out.Bytes()))
+	b.WriteString("\n\n")
+	b.WriteString(statusStyle.Render(m.status))
+	b.WriteString("\n> " + m.cmd)
+
+	return b.String()
+}
+
+// renderSource prints the brainfuck source with the byte range the current
+// instruction was compiled from highlighted.
+func (m model) renderSource() string {
+	if m.done {
+		return m.source
+	}
+
+	start, end := m.dbg.vm.Source(m.dbg.vm.IP())
+	if start >= len(m.source) {
+		return m.source
+	}
+	if end > len(m.source) {
+		end = len(m.source)
+	}
+
+	return m.source[:start] + currentStyle.Render(m.source[start:end]) + m.source[end:]
+}
+
+// renderTape prints the memory tape as a row of cells around the data
+// pointer, with the pointer's cell highlighted.
+func (m model) renderTape() string {
+	mem := m.dbg.vm.Memory()
+	ptr := m.dbg.vm.Ptr()
+
+	const window = 8
+	low := ptr - window
+	if low < 0 {
+		low = 0
+	}
+	high := ptr + window
+	if high >= len(mem) {
+		high = len(mem) - 1
+	}
+
+	var cells []string
+	for i := low; i <= high; i++ {
+		cell := fmt.Sprintf("%3d", mem[i])
+		if i == ptr {
+			cell = ptrStyle.Render(cell)
+		}
+		cells = append(cells, cell)
+	}
+
+	return strings.Join(cells, " ")
+}
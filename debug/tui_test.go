@@ -0,0 +1,56 @@
+package debug
+
+import "testing"
+
+// fatFingerVM is just enough of a Machine to build a Debugger around - the
+// tests below never actually Step it.
+type fatFingerVM struct{}
+
+func (fatFingerVM) Step() error           { return nil }
+func (fatFingerVM) IP() int               { return 0 }
+func (fatFingerVM) SetIP(int)             {}
+func (fatFingerVM) Ptr() int              { return 0 }
+func (fatFingerVM) SetPtr(int)            {}
+func (fatFingerVM) Memory() []int         { return nil }
+func (fatFingerVM) Len() int              { return 0 }
+func (fatFingerVM) Source(int) (int, int) { return 0, 0 }
+
+func TestRunCommandRejectsMissingArgs(t *testing.T) {
+	cases := []string{"break offset", "break ptr"}
+
+	for _, cmd := range cases {
+		dbg := New(fatFingerVM{}, "", NewSink())
+		m := model{dbg: dbg, cmd: cmd}
+
+		m.runCommand() // must not panic
+
+		if len(dbg.breakpoints) != 0 {
+			t.Errorf("%q: expected no breakpoint to be registered, got %+v", cmd, dbg.breakpoints)
+		}
+	}
+}
+
+func TestRunCommandAcceptsCompleteArgs(t *testing.T) {
+	cases := []struct {
+		cmd    string
+		reason BreakReason
+	}{
+		{"break offset 10", BreakOffset},
+		{"break ptr 5", BreakPtrEnters},
+		{"break mem 3 65", BreakMemoryBecomes},
+	}
+
+	for _, c := range cases {
+		dbg := New(fatFingerVM{}, "", NewSink())
+		m := model{dbg: dbg, cmd: c.cmd}
+
+		m.runCommand()
+
+		if len(dbg.breakpoints) != 1 {
+			t.Fatalf("%q: expected 1 breakpoint, got %d", c.cmd, len(dbg.breakpoints))
+		}
+		if dbg.breakpoints[0].Reason != c.reason {
+			t.Errorf("%q: expected reason %v, got %v", c.cmd, c.reason, dbg.breakpoints[0].Reason)
+		}
+	}
+}
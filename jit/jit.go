@@ -0,0 +1,498 @@
+//go:build amd64 && linux
+
+// Package jit turns the same compiled-instruction representation that the
+// closure interpreter in package main walks over into native x86-64 machine
+// code, and runs it directly instead of looping over Go closures.
+//
+// It exists purely as a speed experiment: the closure-based VM is already
+// branch-light, but it still pays for a Go function-call and an instruction
+// pointer bump per brainfuck operation.  Native code pays neither.
+//
+// The generated code keeps the data pointer in r12 for the lifetime of the
+// program, and represents each cell as a full machine word (8 bytes) to
+// match the VM's memory slice - it is not a byte-cell JIT.  Cell wraparound
+// narrower than 32 bits, EOF behaviour and which fds "," and "." talk to are
+// all baked into the generated code at Compile time from Options, mirroring
+// the subset of main.Config the JIT can honour; every data-pointer move is
+// bounds-checked against mem's extent, since Options has no tape-growth or
+// wraparound mode to offer the generated code instead.
+package jit
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// Op identifies one instruction in the compiled program.
+//
+// This mirrors the set of closures package main's New() can emit, including
+// the idioms its peephole optimizer recognises, so that the JIT can reuse
+// exactly the same compiled representation as the closure interpreter.
+type Op int
+
+const (
+	// OpIncCell adds Arg to the current cell (Arg may be negative).
+	OpIncCell Op = iota
+	// OpIncPtr adds Arg to the data pointer (Arg may be negative).
+	OpIncPtr
+	// OpRead reads one byte of input into the current cell.
+	OpRead
+	// OpWrite writes the current cell's low byte to output.
+	OpWrite
+	// OpLoopOpen jumps to Target if the current cell is zero.
+	OpLoopOpen
+	// OpLoopClose jumps to Target if the current cell is non-zero.
+	OpLoopClose
+	// OpClearCell sets the current cell to zero.
+	OpClearCell
+	// OpMulMove distributes the current cell across Offsets and zeroes it.
+	OpMulMove
+	// OpScanRight advances the pointer by Arg until it finds a zero cell.
+	OpScanRight
+	// OpScanLeft retreats the pointer by Arg until it finds a zero cell.
+	OpScanLeft
+	// OpExit terminates the program.
+	OpExit
+)
+
+// Instr is a single compiled instruction, as produced by package main's
+// compile step.
+type Instr struct {
+	Op Op
+
+	// Arg is the operand for OpIncCell, OpIncPtr, OpScanRight and
+	// OpScanLeft.
+	Arg int
+
+	// Target is the instruction index to jump to for OpLoopOpen and
+	// OpLoopClose.
+	Target int
+
+	// Offsets holds the offset->multiplier pairs for OpMulMove.
+	Offsets map[int]int
+}
+
+// EOFBehavior mirrors main.EOFBehavior: what OpRead should leave in the
+// current cell once the configured input is exhausted. It's redeclared here,
+// rather than shared, because jit can't import package main and this is the
+// smallest surface that lets Compile bake the right behaviour into OpRead's
+// generated code.
+type EOFBehavior int
+
+const (
+	// EOFLeaveUnchanged leaves the current cell as it was.
+	EOFLeaveUnchanged EOFBehavior = iota
+	// EOFZero sets the current cell to zero.
+	EOFZero
+	// EOFMinusOne sets every bit of the cell's configured mask.
+	EOFMinusOne
+)
+
+// Options configures the subset of a VM's I/O and cell semantics Compile
+// bakes directly into the generated code.
+type Options struct {
+	// CellMask is ANDed into a cell after every write, giving it
+	// wraparound narrower than the full 32-bit cells the generated code
+	// otherwise uses. It should be main's Config.CellSize.mask().
+	CellMask int32
+
+	// EOFBehavior controls what OpRead leaves in the cell once input is
+	// exhausted.
+	EOFBehavior EOFBehavior
+
+	// StdinFd and StdoutFd are the file descriptors OpRead and OpWrite
+	// talk to directly via raw syscalls - the JIT doesn't go through an
+	// io.Reader/io.Writer, so whatever Config.Stdin/Stdout the caller
+	// configured must be backed by a real, already-open file descriptor.
+	StdinFd, StdoutFd int32
+}
+
+// Program is a compiled, mmap'd, runnable brainfuck program.
+type Program struct {
+	code []byte
+	mem  []int
+
+	// oob is set by the generated code's bounds check if a data-pointer
+	// move ever leaves mem's extent, and checked by Run once the code
+	// returns.
+	oob *byte
+}
+
+// cellBytes is the size, in bytes, of a single brainfuck cell as the JIT
+// represents it - one machine word, matching the VM's memory slice.
+const cellBytes = 8
+
+// Compile generates native x86-64 machine code for prog, operating on mem
+// as its tape, and returns a Program ready to Run. Every pointer move in
+// the generated code is bounds-checked against mem's extent; Run reports an
+// error rather than corrupting memory past it, the way an unbounded tape
+// mode would need to grow or wrap instead - Compile has no way to honour
+// those modes in native code, so it always enforces a bounded tape.
+func Compile(prog []Instr, mem []int, opts Options) (*Program, error) {
+	if len(mem) == 0 {
+		return nil, fmt.Errorf("jit: memory must not be empty")
+	}
+
+	var code []byte
+	offsets := make([]int, len(prog)+1)
+
+	// Pending jump patches: code-offset of the rel32 operand, and the
+	// instruction index (or, for boundsPatches, the bail stub) it should
+	// resolve to.
+	type patch struct {
+		at     int
+		target int
+	}
+	var patches []patch
+	var boundsPatches []int
+
+	emit := func(b ...byte) {
+		code = append(code, b...)
+	}
+	emitImm32 := func(v int32) {
+		emit(byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+	}
+
+	// Prologue: save the caller's rbx/r12/r13/r15, then load the tape's
+	// low bound into rbx and r12 (the latter being the live data
+	// pointer), its high bound into r13, and the address of an
+	// out-of-bounds flag into r15.
+	emit(0x53)       // push rbx
+	emit(0x41, 0x54) // push r12
+	emit(0x41, 0x55) // push r13
+	emit(0x41, 0x57) // push r15
+
+	oob := new(byte)
+	lowAddr := uint64(uintptr(unsafe.Pointer(&mem[0])))
+	highAddr := uint64(uintptr(unsafe.Pointer(&mem[len(mem)-1])))
+	oobAddr := uint64(uintptr(unsafe.Pointer(oob)))
+
+	emit(0x48, 0xBB) // movabs rbx, imm64 (low bound)
+	appendImm64(&code, lowAddr)
+	emit(0x49, 0xBC) // movabs r12, imm64 (data pointer, starts at the low bound)
+	appendImm64(&code, lowAddr)
+	emit(0x49, 0xBD) // movabs r13, imm64 (high bound)
+	appendImm64(&code, highAddr)
+	emit(0x49, 0xBF) // movabs r15, imm64 (out-of-bounds flag address)
+	appendImm64(&code, oobAddr)
+
+	for idx, ins := range prog {
+		offsets[idx] = len(code)
+
+		switch ins.Op {
+		case OpIncCell:
+			emitAddMem(&code, ins.Arg, opts.CellMask)
+
+		case OpIncPtr:
+			// add r12, imm32
+			emit(0x49, 0x81, 0xC4)
+			emitImm32(int32(ins.Arg * cellBytes))
+			emitBoundsCheck(&code, &boundsPatches)
+
+		case OpRead:
+			emitRead(&code, opts.StdinFd, opts.EOFBehavior, opts.CellMask)
+
+		case OpWrite:
+			emit(0xB8, 0x01, 0x00, 0x00, 0x00) // mov eax, 1 (sys_write)
+			emit(0xBF)                         // mov edi, stdoutFd
+			emitImm32(opts.StdoutFd)
+			emit(0x4C, 0x89, 0xE6)             // mov rsi, r12
+			emit(0xBA, 0x01, 0x00, 0x00, 0x00) // mov edx, 1
+			emit(0x0F, 0x05)                   // syscall
+
+		case OpLoopOpen:
+			// cmp qword ptr [r12], 0 ; je <after-matching-close>
+			emit(0x49, 0x81, 0x3C, 0x24)
+			emitImm32(0)
+			emit(0x0F, 0x84)
+			patches = append(patches, patch{at: len(code), target: ins.Target})
+			emitImm32(0)
+
+		case OpLoopClose:
+			// cmp qword ptr [r12], 0 ; jne <matching-open>
+			emit(0x49, 0x81, 0x3C, 0x24)
+			emitImm32(0)
+			emit(0x0F, 0x85)
+			patches = append(patches, patch{at: len(code), target: ins.Target})
+			emitImm32(0)
+
+		case OpClearCell:
+			// mov qword ptr [r12], 0
+			emit(0x49, 0xC7, 0x04, 0x24)
+			emitImm32(0)
+
+		case OpMulMove:
+			emitMulMove(&code, ins.Offsets, opts.CellMask, &boundsPatches)
+
+		case OpScanRight:
+			emitScan(&code, ins.Arg, &boundsPatches)
+
+		case OpScanLeft:
+			emitScan(&code, -ins.Arg, &boundsPatches)
+
+		case OpExit:
+			// fallthrough to the epilogue below
+
+		default:
+			return nil, fmt.Errorf("jit: unsupported opcode %d", ins.Op)
+		}
+	}
+	offsets[len(prog)] = len(code)
+
+	// Normal exit: restore the caller's registers and return.
+	emit(0x41, 0x5F) // pop r15
+	emit(0x41, 0x5D) // pop r13
+	emit(0x41, 0x5C) // pop r12
+	emit(0x5B)       // pop rbx
+	emit(0xC3)       // ret
+
+	// Bounds-check bail: record the violation, then fall into the same
+	// restore-and-return sequence as a normal exit.
+	bailPos := len(code)
+	emit(0x41, 0xC6, 0x07, 0x01) // mov byte ptr [r15], 1
+	emit(0x41, 0x5F)             // pop r15
+	emit(0x41, 0x5D)             // pop r13
+	emit(0x41, 0x5C)             // pop r12
+	emit(0x5B)                   // pop rbx
+	emit(0xC3)                   // ret
+
+	for _, p := range patches {
+		rel := int32(offsets[p.target] - (p.at + 4))
+		code[p.at+0] = byte(rel)
+		code[p.at+1] = byte(rel >> 8)
+		code[p.at+2] = byte(rel >> 16)
+		code[p.at+3] = byte(rel >> 24)
+	}
+	for _, at := range boundsPatches {
+		rel := int32(bailPos - (at + 4))
+		code[at+0] = byte(rel)
+		code[at+1] = byte(rel >> 8)
+		code[at+2] = byte(rel >> 16)
+		code[at+3] = byte(rel >> 24)
+	}
+
+	buf, err := syscall.Mmap(-1, 0, len(code),
+		syscall.PROT_READ|syscall.PROT_WRITE|syscall.PROT_EXEC,
+		syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil, fmt.Errorf("jit: mmap failed: %w", err)
+	}
+	copy(buf, code)
+
+	return &Program{code: buf, mem: mem, oob: oob}, nil
+}
+
+// Run jumps into the compiled machine code and executes it to completion.
+func (p *Program) Run() error {
+	// A Go func value is a pointer to a funcval struct whose first word
+	// is the entry address - calling fn() dereferences fn once to reach
+	// that word. So fn itself can't point directly at our code: it needs
+	// to point at a word that *holds* the code's address, one level of
+	// indirection further out.
+	codeAddr := uintptr(unsafe.Pointer(&p.code[0]))
+
+	var fn func()
+	funcPtr := (*uintptr)(unsafe.Pointer(&fn))
+	*funcPtr = uintptr(unsafe.Pointer(&codeAddr))
+	fn()
+
+	if *p.oob != 0 {
+		return fmt.Errorf("jit: data pointer moved outside the tape")
+	}
+	return nil
+}
+
+// Close releases the mmap'd code page. The Program must not be used again
+// afterwards.
+func (p *Program) Close() error {
+	return syscall.Munmap(p.code)
+}
+
+// emitAddMem appends the code for the brainfuck "+"/"-" idiom: an add at
+// dword width, so that overflow past 32 bits can never leak into the upper
+// half of a cell, followed by an extra mask if CellMask is narrower than
+// that. A negative n encodes as its two's-complement imm32, which is
+// indistinguishable from a subtraction as far as the CPU is concerned.
+func emitAddMem(code *[]byte, n int, mask int32) {
+	if n != 0 {
+		// add dword ptr [r12], imm32
+		*code = append(*code, 0x41, 0x81, 0x04, 0x24)
+		appendImm32(code, int32(n))
+	}
+	emitMask(code, mask)
+}
+
+// emitMask appends "and qword ptr [r12], mask", unless mask is all 32 bits
+// set, in which case dword-width arithmetic has already truncated the cell
+// correctly and there's nothing further to clear. mask is never negative as
+// a 32-bit pattern's top bit set would sign-extend under this opcode and
+// defeat the mask, which CellSize.mask() never produces (it tops out at
+// 0xFFFFFFFF, handled by the dword-width arithmetic instead).
+func emitMask(code *[]byte, mask int32) {
+	if mask == -1 {
+		return
+	}
+	// and qword ptr [r12], imm32
+	*code = append(*code, 0x49, 0x81, 0x24, 0x24)
+	appendImm32(code, mask)
+}
+
+// appendImm32 appends v as four little-endian bytes.
+func appendImm32(code *[]byte, v int32) {
+	*code = append(*code, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// appendImm64 appends v as eight little-endian bytes.
+func appendImm64(code *[]byte, v uint64) {
+	for i := 0; i < 8; i++ {
+		*code = append(*code, byte(v>>(8*i)))
+	}
+}
+
+// emitBoundsCheck appends the instructions that bail out if r12 - just
+// updated by the caller - has moved outside [rbx, r13], the tape's low and
+// high bounds, recording the code offsets of its two rel32 operands in
+// patches so Compile can point them at the bail stub once it knows where
+// that is.
+func emitBoundsCheck(code *[]byte, patches *[]int) {
+	// cmp r12, rbx ; jb bail
+	*code = append(*code, 0x49, 0x39, 0xDC)
+	*code = append(*code, 0x0F, 0x82)
+	*patches = append(*patches, len(*code))
+	appendImm32(code, 0)
+
+	// cmp r12, r13 ; ja bail
+	*code = append(*code, 0x4D, 0x39, 0xEC)
+	*code = append(*code, 0x0F, 0x87)
+	*patches = append(*patches, len(*code))
+	appendImm32(code, 0)
+}
+
+// emitRead appends the code for ",": a read(2) of one byte from stdinFd
+// into the current cell. The cell is never pre-zeroed - that would destroy
+// the value EOFLeaveUnchanged needs to restore - so a successful read
+// zeroes the cell's upper bytes around the byte it just landed, and an EOF
+// applies eof's configured behaviour to a cell that was never touched.
+func emitRead(code *[]byte, stdinFd int32, eof EOFBehavior, mask int32) {
+	// mov eax, 0 (sys_read) ; mov edi, stdinFd ; mov rsi, r12 ; mov edx, 1
+	// syscall
+	*code = append(*code, 0xB8, 0x00, 0x00, 0x00, 0x00)
+	*code = append(*code, 0xBF)
+	appendImm32(code, stdinFd)
+	*code = append(*code, 0x4C, 0x89, 0xE6)
+	*code = append(*code, 0xBA, 0x01, 0x00, 0x00, 0x00)
+	*code = append(*code, 0x0F, 0x05)
+
+	// cmp eax, 0 ; jne success
+	*code = append(*code, 0x83, 0xF8, 0x00)
+	*code = append(*code, 0x75, 0x00)
+	jne := len(*code) - 1
+
+	// EOF: apply the configured behaviour to the still-untouched cell.
+	switch eof {
+	case EOFZero:
+		// mov qword ptr [r12], 0
+		*code = append(*code, 0x49, 0xC7, 0x04, 0x24)
+		appendImm32(code, 0)
+	case EOFMinusOne:
+		// mov qword ptr [r12], 0 ; mov dword ptr [r12], mask
+		*code = append(*code, 0x49, 0xC7, 0x04, 0x24)
+		appendImm32(code, 0)
+		*code = append(*code, 0x41, 0xC7, 0x04, 0x24)
+		appendImm32(code, mask)
+	case EOFLeaveUnchanged:
+		// nothing to do - the cell was never touched.
+	}
+	// jmp done
+	*code = append(*code, 0xEB, 0x00)
+	jmp := len(*code) - 1
+
+	(*code)[jne] = byte(len(*code) - (jne + 1))
+
+	// success: the syscall wrote exactly one byte at [r12]; reload it and
+	// zero the rest of the cell around it.
+	*code = append(*code, 0x41, 0x0F, 0xB6, 0x04, 0x24) // movzx eax, byte ptr [r12]
+	*code = append(*code, 0x49, 0xC7, 0x04, 0x24)       // mov qword ptr [r12], 0
+	appendImm32(code, 0)
+	*code = append(*code, 0x41, 0x88, 0x04, 0x24) // mov byte ptr [r12], al
+
+	// done:
+	(*code)[jmp] = byte(len(*code) - (jmp + 1))
+}
+
+// emitMulMove appends the code for the "[->+<]"-style idiom: load the
+// current cell, and for each offset/multiplier pair scale it and add it
+// into the cell at that offset at dword width (for the same overflow
+// reason emitAddMem uses dword width) plus an extra mask if needed, then
+// zero the current cell. Every target cell is bounds-checked against
+// [rbx, r13] before any of them is touched.
+func emitMulMove(code *[]byte, offsets map[int]int, mask int32, boundsPatches *[]int) {
+	for k := range offsets {
+		// lea rcx, [r12+disp32] ; cmp rcx, rbx ; jb bail
+		*code = append(*code, 0x49, 0x8D, 0x8C, 0x24)
+		appendImm32(code, int32(k*cellBytes))
+		*code = append(*code, 0x48, 0x39, 0xD9, 0x0F, 0x82)
+		*boundsPatches = append(*boundsPatches, len(*code))
+		appendImm32(code, 0)
+
+		// cmp rcx, r13 ; ja bail
+		*code = append(*code, 0x4C, 0x39, 0xE9, 0x0F, 0x87)
+		*boundsPatches = append(*boundsPatches, len(*code))
+		appendImm32(code, 0)
+	}
+
+	// mov rax, qword ptr [r12]
+	*code = append(*code, 0x49, 0x8B, 0x04, 0x24)
+
+	for k, mul := range offsets {
+		// imul rcx, rax, imm32
+		*code = append(*code, 0x48, 0x69, 0xC8)
+		appendImm32(code, int32(mul))
+
+		// add dword ptr [r12+disp32], ecx
+		*code = append(*code, 0x41, 0x01, 0x8C, 0x24)
+		appendImm32(code, int32(k*cellBytes))
+
+		if mask != -1 {
+			// and qword ptr [r12+disp32], mask
+			*code = append(*code, 0x49, 0x81, 0xA4, 0x24)
+			appendImm32(code, int32(k*cellBytes))
+			appendImm32(code, mask)
+		}
+	}
+
+	// mov qword ptr [r12], 0
+	*code = append(*code, 0x49, 0xC7, 0x04, 0x24)
+	appendImm32(code, 0)
+}
+
+// emitScan appends a tight loop which advances r12 by stride*cellBytes,
+// bounds-checking it on every iteration, until the cell it now points at is
+// zero. A negative stride scans leftwards.
+func emitScan(code *[]byte, stride int, boundsPatches *[]int) {
+	loopStart := len(*code)
+
+	// cmp qword ptr [r12], 0
+	*code = append(*code, 0x49, 0x81, 0x3C, 0x24)
+	appendImm32(code, 0)
+
+	// je <past the add+bounds-check+jmp below>, patched once we know how
+	// long that is rather than hand-counted, since a hand-counted
+	// distance here is exactly what drifted out of sync once already.
+	*code = append(*code, 0x74, 0x00)
+	je := len(*code) - 1
+
+	// add r12, imm32
+	*code = append(*code, 0x49, 0x81, 0xC4)
+	appendImm32(code, int32(stride*cellBytes))
+
+	emitBoundsCheck(code, boundsPatches)
+
+	// jmp loopStart
+	rel := int32(loopStart - (len(*code) + 5))
+	*code = append(*code, 0xE9)
+	appendImm32(code, rel)
+
+	(*code)[je] = byte(len(*code) - (je + 1))
+}
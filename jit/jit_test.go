@@ -0,0 +1,67 @@
+//go:build amd64 && linux
+
+package jit
+
+import (
+	"os"
+	"testing"
+)
+
+// TestCompileRunWritesExpectedByte builds a tiny program directly out of
+// Instr values - incrementing the current cell then writing it - and checks
+// the generated code actually produces the expected byte.
+func TestCompileRunWritesExpectedByte(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem := make([]int, 4)
+	prog := []Instr{
+		{Op: OpIncCell, Arg: 65},
+		{Op: OpWrite},
+		{Op: OpExit},
+	}
+
+	p, err := Compile(prog, mem, Options{
+		CellMask: -1,
+		StdoutFd: int32(w.Fd()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	out := make([]byte, 1)
+	if _, err := r.Read(out); err != nil {
+		t.Fatal(err)
+	}
+	if out[0] != 'A' {
+		t.Fatalf("got %q, want 'A'", out[0])
+	}
+}
+
+// TestCompileRunBoundsChecksPointer checks that a pointer move past the
+// tape's extent is reported as an error instead of corrupting memory.
+func TestCompileRunBoundsChecksPointer(t *testing.T) {
+	mem := make([]int, 4)
+	prog := []Instr{
+		{Op: OpIncPtr, Arg: 1000},
+		{Op: OpExit},
+	}
+
+	p, err := Compile(prog, mem, Options{CellMask: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.Run(); err == nil {
+		t.Fatal("expected an out-of-bounds error")
+	}
+}
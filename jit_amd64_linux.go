@@ -0,0 +1,93 @@
+//go:build amd64 && linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skx/closure-based-brainfuck-vm/jit"
+)
+
+// RunProgramJIT compiles the program to native x86-64 machine code and runs
+// it directly, instead of looping over the closures New() produced.
+//
+// It lowers the exact same []op compileProgram produces for New() - rather
+// than re-scanning bf itself - so the JIT can never disagree with the
+// closure interpreter about where a loop starts, how a run collapses, or
+// which idiom a peephole matched.
+//
+// Only a VM built with Config.TapeMode == TapeBounded, and Stdin/Stdout
+// backed by a real *os.File, can be JIT-compiled: the generated code talks
+// to the tape and to I/O directly, with no room for an arbitrary
+// io.Reader/io.Writer or a wrap/grow tape mode to hook into. Anything else
+// is refused outright rather than silently ignored.
+func (vm *VM) RunProgramJIT(bf string) error {
+	ops, err := compileProgram(bf)
+	if err != nil {
+		return err
+	}
+
+	if vm.config.TapeMode != TapeBounded {
+		return fmt.Errorf("jit: TapeMode %d is not supported by the JIT, only TapeBounded", vm.config.TapeMode)
+	}
+
+	stdin, ok := vm.config.Stdin.(*os.File)
+	if !ok {
+		return fmt.Errorf("jit: Config.Stdin must be an *os.File to JIT-compile, got %T", vm.config.Stdin)
+	}
+	stdout, ok := vm.config.Stdout.(*os.File)
+	if !ok {
+		return fmt.Errorf("jit: Config.Stdout must be an *os.File to JIT-compile, got %T", vm.config.Stdout)
+	}
+
+	instrs := make([]jit.Instr, 0, len(ops)+1)
+	for _, o := range ops {
+		instrs = append(instrs, lowerOpIR(o))
+	}
+	instrs = append(instrs, jit.Instr{Op: jit.OpExit})
+
+	opts := jit.Options{
+		CellMask:    int32(uint32(vm.config.CellSize.mask())),
+		EOFBehavior: jit.EOFBehavior(vm.config.EOFBehavior),
+		StdinFd:     int32(stdin.Fd()),
+		StdoutFd:    int32(stdout.Fd()),
+	}
+
+	prog, err := jit.Compile(instrs, vm.memory[:], opts)
+	if err != nil {
+		return err
+	}
+	defer prog.Close()
+
+	return prog.Run()
+}
+
+// lowerOpIR turns a single compiled op into the jit.Instr the native-code
+// compiler runs for it - the JIT's equivalent of lowerOp.
+func lowerOpIR(o op) jit.Instr {
+	switch o.kind {
+	case opIncCell:
+		return jit.Instr{Op: jit.OpIncCell, Arg: o.arg}
+	case opIncPtr:
+		return jit.Instr{Op: jit.OpIncPtr, Arg: o.arg}
+	case opRead:
+		return jit.Instr{Op: jit.OpRead}
+	case opWrite:
+		return jit.Instr{Op: jit.OpWrite}
+	case opLoopOpen:
+		return jit.Instr{Op: jit.OpLoopOpen, Target: o.target}
+	case opLoopClose:
+		return jit.Instr{Op: jit.OpLoopClose, Target: o.target}
+	case opClearCell:
+		return jit.Instr{Op: jit.OpClearCell}
+	case opMulMove:
+		return jit.Instr{Op: jit.OpMulMove, Offsets: o.offsets}
+	case opScanRight:
+		return jit.Instr{Op: jit.OpScanRight, Arg: o.arg}
+	case opScanLeft:
+		return jit.Instr{Op: jit.OpScanLeft, Arg: o.arg}
+	default:
+		return jit.Instr{}
+	}
+}
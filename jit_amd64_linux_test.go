@@ -0,0 +1,74 @@
+//go:build amd64 && linux
+
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+// TestJITMatchesInterpreter runs a handful of programs through both
+// RunProgram and RunProgramJIT and checks they produce identical stdout -
+// the two are meant to be indistinguishable to a caller, and a JIT
+// regression that changes behaviour without also breaking the interpreter
+// would otherwise go unnoticed.
+func TestJITMatchesInterpreter(t *testing.T) {
+	cases := []struct {
+		name string
+		bf   string
+	}{
+		{name: "hello world", bf: "++++++++[>++++[>++>+++>+++>+<<<<-]>+>+>->>+[<]<-]>>.>---.+++++++..+++.>>.<-.<.+++.------.--------.>>+.>++."},
+		{name: "clear cell idiom", bf: "+++++[-]."},
+		{name: "scan right idiom", bf: "+>+>+>+[>]<."},
+		{name: "move loop idiom", bf: "+++++[->>>+<<<]>>>."},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			interp := runCapturingStdout(t, c.bf, func(vm *VM, bf string) error {
+				return vm.RunProgram()
+			})
+			jit := runCapturingStdout(t, c.bf, func(vm *VM, bf string) error {
+				return vm.RunProgramJIT(bf)
+			})
+
+			if interp != jit {
+				t.Errorf("interpreter produced %q, JIT produced %q", interp, jit)
+			}
+		})
+	}
+}
+
+// runCapturingStdout builds a VM over bf with Stdout pointed at a pipe,
+// runs it with run, and returns whatever was written. run's VM's Stdin is
+// never exercised by the cases above, so Config.Stdin is left as the
+// default.
+func runCapturingStdout(t *testing.T, bf string, run func(vm *VM, bf string) error) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Stdout = w
+	cfg.BufferStdout = false
+
+	vm, err := New(bf, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run(vm, bf); err != nil {
+		t.Fatal(err)
+	}
+
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
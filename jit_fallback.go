@@ -0,0 +1,12 @@
+//go:build !(amd64 && linux)
+
+package main
+
+import "errors"
+
+// RunProgramJIT is unavailable outside amd64/linux, where the jit package's
+// native code generator isn't implemented. Callers should fall back to
+// RunProgram.
+func (vm *VM) RunProgramJIT(bf string) error {
+	return errors.New("jit: not supported on this platform, use RunProgram instead")
+}
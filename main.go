@@ -31,8 +31,10 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 )
 
@@ -53,19 +55,45 @@ type VM struct {
 	// ptr is the brainfuck programs index offset.
 	ptr int
 
-	// memory is the memory-space the brainfuck program uses
-	memory [30000]int
+	// memory is the memory-space the brainfuck program uses. Unlike a
+	// fixed-size array this can grow at runtime, under TapeDynamic.
+	memory []int
 
-	// stdout holds output we should write to the console.
+	// config holds the I/O and memory semantics the VM was built with.
+	config Config
+
+	// cellMask is derived from config.CellSize, and is ANDed into a cell
+	// after every write to give it wraparound behaviour.
+	cellMask int
+
+	// stdout is where buffered writes go, when config.BufferStdout is
+	// set; nil otherwise, in which case writes go to config.Stdout
+	// directly.
 	//
-	// We do this because writing a single byte to STDOUT is inefficient
-	// and by buffering until we get a complete line we get a little
-	// speed-boost.
-	stdout string
+	// Buffering a byte at a time into a bufio.Writer, and flushing on a
+	// newline, avoids the syscall-per-character cost of writing straight
+	// through while still keeping output reasonably prompt.
+	stdout *bufio.Writer
 
 	// program contains the set of closures that we can
 	// execute one by one, to run the actual compiled brainfuck program.
 	program []vmFunc
+
+	// SourceMap records, for each slot in program, the byte range of the
+	// brainfuck source which that slot was compiled from. It is indexed
+	// the same way as program, so SourceMap[vm.ip] is always the range
+	// the closure about to run came from.
+	//
+	// It exists to let tooling - a debugger, for instance - show the
+	// user which part of the original source is currently executing.
+	SourceMap []SourceRange
+}
+
+// SourceRange is a half-open [Start,End) byte range into the brainfuck
+// source a program slot was compiled from.
+type SourceRange struct {
+	Start int
+	End   int
 }
 
 // vmFunc is the type-signature of our closures.
@@ -77,135 +105,92 @@ type vmFunc func(vm *VM) error
 
 // New is the VM constructor which takes our program as input
 // and compiles it into a series of closures.
-func New(bf string) (*VM, error) {
+func New(bf string, cfg Config) (*VM, error) {
 
-	// Ensure we got a program
-	if len(bf) < 1 {
-		return nil, errors.New("empty program is invalid")
+	// Compile the source into the shared instruction representation;
+	// RunProgramJIT lowers the very same ops to native code, so the two
+	// can never disagree on what a run, a loop or a peephole idiom is.
+	ops, err := compileProgram(bf)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create empty VM
-	v := VM{}
-
-	// Setup a stack we can use to match loops as we compile
-	loopStack := []int{}
-
-	// Should we buffer writes to STDOUT?
-	buffer := true
-	if os.Getenv("BUFFER_STDOUT") == "false" {
-		buffer = false
+	v := VM{
+		config:   cfg,
+		memory:   make([]int, cfg.MemorySize),
+		cellMask: cfg.CellSize.mask(),
 	}
 
-	// Index and bounds for walking the string of brainfuck source code
-	i := 0
-	max := len(bf)
-
-	// inline function - designed to count how many consecutive times
-	// we see the given character, c, repeated.  Returns the count and
-	// the updated index variable for the program source.
-	//
-	// This is a bit horrid, but avoids repetition in the handlers.
-	countRepeats := func(i int, c byte) (int, int) {
-		// Record our starting position in the program source.
-		begin := i
-
-		// See if this character is repeated.
-		for i < max {
-
-			// Not a repeat?  Stop
-			if bf[i] != c {
-				break
-			}
-
-			// Otherwise keep advancing forward
-			i++
-		}
-
-		// How many consecutive "+" did we see?
-		count := i - begin
-
-		// We'll end with an i++ so counter that
-		i--
+	if cfg.BufferStdout {
+		v.stdout = bufio.NewWriter(cfg.Stdout)
+	}
 
-		return count, i
+	for _, o := range ops {
+		v.program = append(v.program, lowerOp(&v, o))
+		v.SourceMap = append(v.SourceMap, SourceRange{o.start, o.end})
 	}
 
-	// Walk over the input program
-	for i < max {
+	// Finally add a fake "exit" trap to the end of our program
+	v.program = append(v.program, makeExit())
+	v.SourceMap = append(v.SourceMap, SourceRange{len(bf), len(bf)})
 
-		// The character we're looking at right now.
-		c := bf[i]
+	// Return the VM, we're now ready to be executed.
+	return &v, nil
+}
 
-		// Handle each known character.
-		switch c {
-		case '+':
-			// Count how many times "+" was repeated
-			count := 0
-			count, i = countRepeats(i, c)
+// IP returns the instruction pointer's current value, i.e. the index into
+// program (and SourceMap) that the next Step will execute.
+func (vm *VM) IP() int {
+	return vm.ip
+}
 
-			v.program = append(v.program, makeIncCell(count))
-		case '-':
-			// Count how many times "-" was repeated
-			count := 0
-			count, i = countRepeats(i, c)
+// SetIP sets the instruction pointer. It exists for tooling - a debugger
+// implementing "run to cursor" or reverse-step, for instance - which needs
+// to move execution somewhere other than "the next instruction".
+func (vm *VM) SetIP(ip int) {
+	vm.ip = ip
+}
 
-			v.program = append(v.program, makeDecCell(count))
-		case '<':
-			// Count how many times "<" was repeated
-			count := 0
-			count, i = countRepeats(i, c)
+// Ptr returns the data pointer's current value.
+func (vm *VM) Ptr() int {
+	return vm.ptr
+}
 
-			v.program = append(v.program, makeDecPtr(count))
-		case '>':
-			// Count how many times ">" was repeated
-			count := 0
-			count, i = countRepeats(i, c)
-
-			v.program = append(v.program, makeIncPtr(count))
-		case ',':
-			v.program = append(v.program, makeRead())
-		case '.':
-			if buffer {
-				v.program = append(v.program, makeWriteCached())
-			} else {
-				v.program = append(v.program, makeWrite())
-			}
-		case '[':
-			// loop open
-			loopStack = append(loopStack, len(v.program))
+// SetPtr sets the data pointer.
+func (vm *VM) SetPtr(ptr int) {
+	vm.ptr = ptr
+}
 
-			// This will get replaced later, but we need to add _something_
-			// to keep our offsets neat.
-			v.program = append(v.program, nil)
+// Memory returns the VM's tape. The returned slice aliases the VM's own
+// memory, so writes through it affect the running program.
+func (vm *VM) Memory() []int {
+	return vm.memory[:]
+}
 
-		case ']':
-			// So this is a loop-close, and we've got a stack which contains
-			// the loop-start.
-			//
-			// Pop off the topmost value, which is our loop open.
-			openInstruction := loopStack[len(loopStack)-1]
-			loopStack = loopStack[:len(loopStack)-1]
-
-			// We want the open-instruction to point to the position of the
-			// close instruction we're just going to compile, so that's the
-			// length of the program:
-			v.program[openInstruction] = makeLoopOpen(len(v.program))
-
-			// Now add the instruction itself, which will jump back to the
-			// loop opening.
-			v.program = append(v.program, makeLoopClose(openInstruction))
-		default:
-			// Invalid character.
-			// ignored.
-		}
-		i++
-	}
+// Len returns the number of slots in the compiled program.
+func (vm *VM) Len() int {
+	return len(vm.program)
+}
 
-	// Finally add a fake "exit" trap to the end of our program
-	v.program = append(v.program, makeExit())
+// Source returns the [start,end) byte range of the brainfuck source that
+// the program slot at ip was compiled from.
+func (vm *VM) Source(ip int) (start, end int) {
+	r := vm.SourceMap[ip]
+	return r.Start, r.End
+}
 
-	// Return the VM, we're now ready to be executed.
-	return &v, nil
+// Step executes a single closure from the compiled program and returns.
+//
+// It exists as its own method, separate from RunProgram's loop, so that
+// callers - a debugger, say - can drive the VM one instruction at a time
+// and inspect its state between steps.
+func (vm *VM) Step() error {
+	// Call the closure.
+	//
+	// Here we assume that each opcode ends with
+	// "vm.ip++", which lets us run forward.
+	return vm.program[vm.ip](vm)
 }
 
 // RunProgram executes the program which was given in the constructor.
@@ -221,19 +206,14 @@ func (vm *VM) RunProgram() error {
 	// For each operation.  Run it
 	for {
 
-		// Call the closure.
-		//
-		// Here we assume that each opcode ends with
-		// "vm.ip++", which lets us run forward.
-		err = vm.program[vm.ip](vm)
+		err = vm.Step()
 
 		// Did we get an error?
 		if err != nil {
 
-			// Show any pending output
-			if vm.stdout != "" {
-				fmt.Printf("%s\n", vm.stdout)
-				vm.stdout = ""
+			// Flush any output we were holding onto.
+			if vm.stdout != nil {
+				vm.stdout.Flush()
 			}
 
 			// If it is the fake exit-program error
@@ -260,7 +240,7 @@ func makeExit() vmFunc {
 // makeIncCell implements the brainfuck cell-increment operation.
 func makeIncCell(n int) vmFunc {
 	return func(v *VM) error {
-		v.memory[v.ptr] += n
+		v.memory[v.ptr] = (v.memory[v.ptr] + n) & v.cellMask
 		v.ip++
 		return nil
 	}
@@ -269,7 +249,7 @@ func makeIncCell(n int) vmFunc {
 // makeDecCell implements the brainfuck cell-decrement operation.
 func makeDecCell(n int) vmFunc {
 	return func(v *VM) error {
-		v.memory[v.ptr] -= n
+		v.memory[v.ptr] = (v.memory[v.ptr] - n) & v.cellMask
 		v.ip++
 		return nil
 	}
@@ -278,7 +258,7 @@ func makeDecCell(n int) vmFunc {
 // makeIncPtr implements the brainfuck ptr-increment operation.
 func makeIncPtr(n int) vmFunc {
 	return func(v *VM) error {
-		v.ptr += n
+		v.movePtr(n)
 		v.ip++
 		return nil
 	}
@@ -287,24 +267,71 @@ func makeIncPtr(n int) vmFunc {
 // makeDecPtr implements the brainfuck ptr-decrement operation.
 func makeDecPtr(n int) vmFunc {
 	return func(v *VM) error {
-		v.ptr -= n
+		v.movePtr(-n)
 		v.ip++
 		return nil
 	}
 }
 
+// movePtr moves the data pointer by n cells, applying the VM's configured
+// TapeMode.
+func (v *VM) movePtr(n int) {
+	v.ptr = v.cellIndex(n)
+}
+
+// cellIndex resolves the memory index of the cell at offset cells from the
+// data pointer, applying the VM's configured TapeMode the same way movePtr
+// does - growing the tape under TapeDynamic, or wrapping under
+// TapeWrapAround - without moving the data pointer itself.
+//
+// It exists so that anything which touches a cell other than the current
+// one, such as makeMulMove's offsets, honours TapeMode exactly like a
+// "move the pointer, touch the cell, move it back" sequence of individual
+// instructions would, rather than indexing v.memory directly and bypassing
+// it.
+func (v *VM) cellIndex(offset int) int {
+	idx := v.ptr + offset
+
+	switch v.config.TapeMode {
+	case TapeWrapAround:
+		size := len(v.memory)
+		idx %= size
+		if idx < 0 {
+			idx += size
+		}
+	case TapeDynamic:
+		if idx >= len(v.memory) {
+			v.memory = append(v.memory, make([]int, idx-len(v.memory)+1)...)
+		}
+	}
+
+	return idx
+}
+
 // makeRead implements the brainfuck STDIN-reading operation.
 func makeRead() vmFunc {
 	return func(v *VM) error {
 		buf := make([]byte, 1)
-		l, err := os.Stdin.Read(buf)
+		l, err := v.config.Stdin.Read(buf)
 		if err != nil {
+			if err == io.EOF {
+				switch v.config.EOFBehavior {
+				case EOFZero:
+					v.memory[v.ptr] = 0
+				case EOFMinusOne:
+					v.memory[v.ptr] = v.cellMask
+				case EOFLeaveUnchanged:
+					// nothing to do
+				}
+				v.ip++
+				return nil
+			}
 			return err
 		}
 		if l != 1 {
 			return fmt.Errorf("read %d bytes of input, not 1", l)
 		}
-		v.memory[v.ptr] = int(buf[0])
+		v.memory[v.ptr] = int(buf[0]) & v.cellMask
 		v.ip++
 		return nil
 	}
@@ -313,29 +340,157 @@ func makeRead() vmFunc {
 // makeWrite implements the brainfuck STDOUT-writing operation, with no caching.
 func makeWrite() vmFunc {
 	return func(v *VM) error {
-		fmt.Printf("%c", v.memory[v.ptr])
+		fmt.Fprintf(v.config.Stdout, "%c", v.memory[v.ptr])
 		v.ip++
 		return nil
 	}
 }
 
 // makeWriteCached implements the brainfuck STDOUT-writing operation.
-// We cache output until we see a newline as a minor optimization.
+// We buffer output until we see a newline as a minor optimization.
 func makeWriteCached() vmFunc {
 	return func(v *VM) error {
 		// character to print
 		c := v.memory[v.ptr]
 
+		v.stdout.WriteRune(rune(c))
+
 		// newline?  show all pending output
 		if c == '\n' {
-			fmt.Printf("%s\n", v.stdout)
-			v.stdout = ""
-		} else {
-			// otherwise save away
-			v.stdout += string(rune(v.memory[v.ptr]))
+			v.stdout.Flush()
+		}
+		v.ip++
+
+		return nil
+	}
+}
+
+// findMatchingBracket returns the index of the "]" which closes the "["
+// found at position open, alongside whether a match was found at all.
+//
+// It tracks nesting depth, so a nested loop inside the body is skipped
+// over rather than mistaken for the closing bracket. The peephole patterns
+// we recognise are all flat, single-level loops, so such a body is then
+// simply rejected by peepholeOp.
+func findMatchingBracket(bf string, open int) (int, bool) {
+	depth := 0
+
+	for i := open; i < len(bf); i++ {
+		switch bf[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i, true
+			}
+			if depth < 0 {
+				return 0, false
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// allBytes reports whether every byte of s is equal to c.
+func allBytes(s string, c byte) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] != c {
+			return false
+		}
+	}
+	return true
+}
+
+// moveLoopOffsets walks a loop body made up only of "+", "-", "<" and ">"
+// and, if it decrements the starting cell by exactly one and returns the
+// pointer to its starting position, returns the per-offset multiplier the
+// starting cell's value should be distributed with.
+//
+// Any other character, or a body which doesn't net to a zero pointer
+// offset with a starting-cell delta of exactly -1, is rejected.
+func moveLoopOffsets(body string) (map[int]int, bool) {
+	offset := 0
+	deltas := map[int]int{}
+
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '+':
+			deltas[offset]++
+		case '-':
+			deltas[offset]--
+		case '>':
+			offset++
+		case '<':
+			offset--
+		default:
+			return nil, false
+		}
+	}
+
+	if offset != 0 {
+		return nil, false
+	}
+	if deltas[0] != -1 {
+		return nil, false
+	}
+
+	delete(deltas, 0)
+	if len(deltas) == 0 {
+		return nil, false
+	}
+
+	return deltas, true
+}
+
+// makeClearCell implements the "[-]"/"[+]" idiom, setting the current
+// cell to zero in a single step rather than looping until it naturally
+// decrements/increments to zero.
+func makeClearCell() vmFunc {
+	return func(v *VM) error {
+		v.memory[v.ptr] = 0
+		v.ip++
+		return nil
+	}
+}
+
+// makeMulMove implements the "[->+<]"-style idiom: it distributes the
+// current cell's value across the cells at the given offsets, scaled by
+// the associated multiplier, then zeroes the current cell.
+func makeMulMove(offsets map[int]int) vmFunc {
+	return func(v *VM) error {
+		cur := v.memory[v.ptr]
+		for k, mul := range offsets {
+			idx := v.cellIndex(k)
+			v.memory[idx] = (v.memory[idx] + cur*mul) & v.cellMask
+		}
+		v.memory[v.ptr] = 0
+		v.ip++
+		return nil
+	}
+}
+
+// makeScanRight implements the "[>]" idiom, advancing the pointer by
+// stride until it finds a zero cell.
+func makeScanRight(stride int) vmFunc {
+	return func(v *VM) error {
+		for v.memory[v.ptr] != 0 {
+			v.movePtr(stride)
 		}
 		v.ip++
+		return nil
+	}
+}
 
+// makeScanLeft implements the "[<]" idiom, retreating the pointer by
+// stride until it finds a zero cell.
+func makeScanLeft(stride int) vmFunc {
+	return func(v *VM) error {
+		for v.memory[v.ptr] != 0 {
+			v.movePtr(-stride)
+		}
+		v.ip++
 		return nil
 	}
 }
@@ -391,7 +546,7 @@ func main() {
 	}
 
 	// create an interpreter to run that program.
-	v, err := New(string(dat))
+	v, err := New(string(dat), DefaultConfig())
 	if err != nil {
 		fmt.Printf("error compiling program: %s\n", err.Error())
 		return
@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+// TestMulMoveHonoursTapeMode pins makeMulMove's behaviour under every
+// TapeMode: it must grow/wrap the tape through the same path movePtr does,
+// rather than indexing v.memory directly and faulting on exactly the same
+// offsets a sequence of individual "+"/">" instructions would grow or wrap
+// through without trouble.
+func TestMulMoveHonoursTapeMode(t *testing.T) {
+	// "+++++[->>>+<<<]" decrements cell 0 and adds its value, times one,
+	// to the cell at offset 3 - past the end of both tapes below.
+	bf := "+++++[->>>+<<<]"
+
+	cases := []struct {
+		name       string
+		mode       TapeMode
+		memorySize int
+		wantCell   int // the cell the moved value should land in
+		wantVal    int
+	}{
+		{name: "TapeDynamic grows", mode: TapeDynamic, memorySize: 3, wantCell: 3, wantVal: 5},
+		// A 2-cell tape wraps offset 3 onto cell 1, distinct from the
+		// starting cell 0 - wrapping offset 3 on a 3-cell tape would
+		// land back on the control cell itself and prove nothing.
+		{name: "TapeWrapAround wraps", mode: TapeWrapAround, memorySize: 2, wantCell: 1, wantVal: 5},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.MemorySize = c.memorySize
+			cfg.TapeMode = c.mode
+
+			v, err := New(bf, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := v.RunProgram(); err != nil {
+				t.Fatal(err)
+			}
+
+			mem := v.Memory()
+			if c.wantCell >= len(mem) {
+				t.Fatalf("tape only grew to %d cells, want at least %d", len(mem), c.wantCell+1)
+			}
+			if mem[c.wantCell] != c.wantVal {
+				t.Errorf("cell %d = %d, want %d (memory: %v)", c.wantCell, mem[c.wantCell], c.wantVal, mem)
+			}
+		})
+	}
+}
+
+// TestMulMoveTapeBoundedStillFaults confirms the fix didn't also paper over
+// TapeBounded, which should still fault exactly like a raw slice index out
+// of range - TapeMode only grows/wraps for TapeDynamic/TapeWrapAround.
+func TestMulMoveTapeBoundedStillFaults(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MemorySize = 3
+	cfg.TapeMode = TapeBounded
+
+	bf := "+++++[->>>+<<<]"
+	v, err := New(bf, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected RunProgram to panic on an out-of-bounds cell access")
+		}
+	}()
+	v.RunProgram()
+}